@@ -0,0 +1,76 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+// Package client is a Go client for tokenizer/server.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmcvetta/tokenizer/server"
+	"net/http"
+)
+
+// Client talks to a tokenizer/server instance over HTTP.
+type Client struct {
+	BaseURL    string // e.g. "http://localhost:8080"
+	AuthToken  string
+	HTTPClient *http.Client
+}
+
+// New returns a Client for the server at baseURL, authenticating with
+// authToken.
+func New(baseURL, authToken string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		AuthToken:  authToken,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Tokenize sends data as a single-request batch to the server's /tokenize
+// endpoint and returns the resulting tokens, keyed the same as data.
+func (c *Client) Tokenize(reqID string, data map[string]string) (map[string]string, error) {
+	return c.call("/tokenize", reqID, data)
+}
+
+// Detokenize sends data as a single-request batch to the server's
+// /detokenize endpoint and returns the original values, keyed the same as
+// data.
+func (c *Client) Detokenize(reqID string, data map[string]string) (map[string]string, error) {
+	return c.call("/detokenize", reqID, data)
+}
+
+func (c *Client) call(path, reqID string, data map[string]string) (map[string]string, error) {
+	body, err := json.Marshal([]server.Request{{ReqID: reqID, Data: data}})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tokenizer server returned %s", resp.Status)
+	}
+	var resps []server.Response
+	if err := json.NewDecoder(resp.Body).Decode(&resps); err != nil {
+		return nil, err
+	}
+	if len(resps) != 1 {
+		return nil, errors.New("tokenizer: expected exactly one response")
+	}
+	if resps[0].Error != "" {
+		return nil, errors.New(resps[0].Error)
+	}
+	return resps[0].Data, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jmcvetta/tokenizer/server"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*Client, func()) {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	c := New(ts.URL, "secret")
+	return c, ts.Close
+}
+
+// Tests the happy path: a single response with no error.
+func TestClientCall(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("expected Authorization header, got %q", got)
+		}
+		json.NewEncoder(w).Encode([]server.Response{
+			{ReqID: "req-1", Data: map[string]string{"field1": "tok-hello"}},
+		})
+	})
+	defer closeServer()
+
+	data, err := c.Tokenize("req-1", map[string]string{"field1": "hello"})
+	if err != nil {
+		t.Fatal("Tokenize error:", err)
+	}
+	if data["field1"] != "tok-hello" {
+		t.Errorf("expected tok-hello, got %q", data["field1"])
+	}
+}
+
+// Tests that a non-200 status is reported as an error.
+func TestClientCallBadStatus(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	})
+	defer closeServer()
+
+	if _, err := c.Tokenize("req-1", map[string]string{"field1": "hello"}); err == nil {
+		t.Error("expected an error for a non-200 status")
+	}
+}
+
+// Tests that a malformed response body is reported as an error.
+func TestClientCallMalformedBody(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	})
+	defer closeServer()
+
+	if _, err := c.Tokenize("req-1", map[string]string{"field1": "hello"}); err == nil {
+		t.Error("expected an error for a malformed response body")
+	}
+}
+
+// Tests that a per-request Error in the response is surfaced to the caller.
+func TestClientCallResponseError(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]server.Response{
+			{ReqID: "req-1", Error: "validation failed"},
+		})
+	})
+	defer closeServer()
+
+	if _, err := c.Tokenize("req-1", map[string]string{"field1": "hello"}); err == nil || err.Error() != "validation failed" {
+		t.Errorf("expected %q, got %v", "validation failed", err)
+	}
+}
+
+// Tests that anything but exactly one response is reported as an error.
+func TestClientCallWrongResponseCount(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]server.Response{})
+	})
+	defer closeServer()
+
+	if _, err := c.Tokenize("req-1", map[string]string{"field1": "hello"}); err == nil {
+		t.Error("expected an error for zero responses")
+	}
+}
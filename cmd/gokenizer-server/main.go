@@ -0,0 +1,61 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+// Command gokenizer-server runs tokenizer/server against a MongoDB-backed
+// Tokenizer.
+package main
+
+import (
+	"errors"
+	"flag"
+	"github.com/jmcvetta/tokenizer"
+	"github.com/jmcvetta/tokenizer/server"
+	"launchpad.net/mgo"
+	"log"
+	"net/http"
+)
+
+// requireAuthToken rejects an empty -auth-token before dialing MongoDB or
+// starting to listen, since a server with no bearer token would accept
+// every request.
+func requireAuthToken(authToken string) error {
+	if authToken == "" {
+		return errors.New("gokenizer-server: -auth-token is required")
+	}
+	return nil
+}
+
+// newHandler wires t behind the batch tokenize/detokenize endpoints,
+// bearer auth and request logging -- everything main does to a
+// tokenizer.Tokenizer once it has one, pulled out so it can be tested
+// without a MongoDB connection.
+func newHandler(t tokenizer.Tokenizer, authToken string) http.Handler {
+	var handler http.Handler = server.New(t).Handler()
+	handler = server.BearerAuth(authToken, handler)
+	handler = server.RequestLog(handler)
+	return handler
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	mongoURL := flag.String("mongo", "localhost", "MongoDB connection URL")
+	mongoDB := flag.String("db", "gokenizer", "MongoDB database name")
+	authToken := flag.String("auth-token", "", "bearer token required of clients")
+	flag.Parse()
+
+	if err := requireAuthToken(*authToken); err != nil {
+		log.Fatal(err)
+	}
+
+	session, err := mgo.Dial(*mongoURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db := session.DB(*mongoDB)
+	t := tokenizer.NewMongoTokenizer(db)
+
+	handler := newHandler(t, *authToken)
+
+	log.Println("gokenizer-server listening on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
@@ -0,0 +1,43 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jmcvetta/tokenizer"
+)
+
+// Tests that an empty -auth-token is rejected.
+func TestRequireAuthToken(t *testing.T) {
+	if err := requireAuthToken(""); err == nil {
+		t.Error("expected an error for an empty auth token")
+	}
+	if err := requireAuthToken("secret"); err != nil {
+		t.Error("expected no error for a non-empty auth token, got", err)
+	}
+}
+
+// Tests that newHandler wires bearer auth in front of the batch endpoints.
+func TestNewHandler(t *testing.T) {
+	handler := newHandler(tokenizer.NewMemoryTokenizer(), "secret")
+
+	req := httptest.NewRequest("POST", "/tokenize", strings.NewReader(`[{"req_id":"r1","data":{"field1":"hello"}}]`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a bearer token, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/tokenize", strings.NewReader(`[{"req_id":"r1","data":{"field1":"hello"}}]`))
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 with a valid bearer token, got %d", w.Code)
+	}
+}
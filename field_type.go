@@ -0,0 +1,127 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrUnknownFieldType is returned by TokenizeField and DetokenizeField if
+// no FieldType has been registered under the given name.
+var ErrUnknownFieldType = errors.New("tokenizer: unknown field type")
+
+// ErrFieldTypeMismatch is returned by DetokenizeField if token was not
+// issued by TokenizeField under the claimed field type -- e.g. a token
+// issued for "email" can't be detokenized as a "pan".
+var ErrFieldTypeMismatch = errors.New("tokenizer: token was not issued for this field type")
+
+// FieldType describes how a single named kind of structured field --
+// "email", "pan", "ssn" and so on -- is tokenized: how its values are
+// normalized and validated before tokenizing, and which Tokenizer mints
+// and reverses its tokens.  A Tokenizer here can be any of the module's
+// strategies: a Store-backed one for random opaque tokens, an
+// NewFPETokenizer for format-preserving ones, or an NewHashTokenizer for
+// deterministic hash-based ones.
+type FieldType struct {
+	Name      string
+	Validate  func(string) error
+	Normalize func(string) string // optional; nil means no normalization
+	Tokenizer Tokenizer
+}
+
+// FieldRegistry maps field type names to their FieldType, so a single
+// point of entry -- TokenizeField / DetokenizeField -- can serve many
+// differently-typed fields of a structured record.
+type FieldRegistry struct {
+	types map[string]FieldType
+}
+
+// NewFieldRegistry returns an empty FieldRegistry.
+func NewFieldRegistry() *FieldRegistry {
+	return &FieldRegistry{types: make(map[string]FieldType)}
+}
+
+// Register adds ft to the registry, replacing any existing FieldType of
+// the same name.
+func (r *FieldRegistry) Register(ft FieldType) {
+	r.types[ft.Name] = ft
+}
+
+// TokenizeField normalizes and validates value as fieldType, then
+// tokenizes it.  If ft.Tokenizer is a FieldTaggedTokenizer (every
+// Store-backed strategy is), the issued token's Record is stamped with
+// fieldType so DetokenizeField can enforce that it's later detokenized as
+// the same type; the token itself is returned unmodified, so format- and
+// length-preserving strategies like the FPE Tokenizer still produce
+// output shaped like value.
+func (r *FieldRegistry) TokenizeField(fieldType, value string) (string, error) {
+	ft, ok := r.types[fieldType]
+	if !ok {
+		return "", ErrUnknownFieldType
+	}
+	if ft.Normalize != nil {
+		value = ft.Normalize(value)
+	}
+	if ft.Validate != nil {
+		if err := ft.Validate(value); err != nil {
+			return "", err
+		}
+	}
+	if tagged, ok := ft.Tokenizer.(FieldTaggedTokenizer); ok {
+		return tagged.TokenizeField(fieldType, value)
+	}
+	return ft.Tokenizer.Tokenize(value)
+}
+
+// DetokenizeField reverses a token produced by TokenizeField under
+// fieldType.  If ft.Tokenizer is a FieldTaggedTokenizer, it returns
+// ErrFieldTypeMismatch if token's Record was stamped with a different
+// field type.  A Tokenizer that isn't FieldTaggedTokenizer -- the FPE
+// Tokenizer, which has no Record to check -- has no way to enforce this
+// and simply detokenizes.
+func (r *FieldRegistry) DetokenizeField(fieldType, token string) (string, error) {
+	ft, ok := r.types[fieldType]
+	if !ok {
+		return "", ErrUnknownFieldType
+	}
+	if tagged, ok := ft.Tokenizer.(FieldTaggedTokenizer); ok {
+		recFieldType, err := tagged.FieldTypeOf(token)
+		if err != nil {
+			return "", err
+		}
+		if recFieldType != fieldType {
+			return "", ErrFieldTypeMismatch
+		}
+	}
+	return ft.Tokenizer.Detokenize(token)
+}
+
+// RegexValidator returns a FieldType.Validate func requiring s to match
+// pattern in full.
+func RegexValidator(pattern string) func(string) error {
+	re := regexp.MustCompile(pattern)
+	return func(s string) error {
+		if !re.MatchString(s) {
+			return fmt.Errorf("tokenizer: %q does not match %s", s, pattern)
+		}
+		return nil
+	}
+}
+
+// StripChars returns a FieldType.Normalize func that removes every rune in
+// chars from its input, e.g. StripChars("-") to normalize "123-45-6789"
+// before tokenizing an SSN.
+func StripChars(chars string) func(string) string {
+	return func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if strings.ContainsRune(chars, r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+}
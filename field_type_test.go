@@ -0,0 +1,88 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tests the field-typed tokenizer registry
+func TestFieldRegistry(t *testing.T) {
+	// Both field types share one Store, as a structured-record registry
+	// typically would, so a cross-field-type mismatch is detected via the
+	// Record's stamped FieldType rather than masked by looking the token
+	// up in a store that never saw it.
+	store := NewMemoryStore()
+	registry := NewFieldRegistry()
+	registry.Register(FieldType{
+		Name:      "email",
+		Validate:  RegexValidator(`^[^@]+@[^@]+\.[^@]+$`),
+		Normalize: strings.ToLower,
+		Tokenizer: NewTokenizer(store),
+	})
+	registry.Register(FieldType{
+		Name:      "ssn",
+		Validate:  RegexValidator(`^\d{9}$`),
+		Normalize: StripChars("-"),
+		Tokenizer: NewTokenizer(store),
+	})
+
+	token, err := registry.TokenizeField("email", "User@Example.com")
+	if err != nil {
+		t.Fatal("TokenizeField error:", err)
+	}
+	detok, err := registry.DetokenizeField("email", token)
+	if err != nil {
+		t.Fatal("DetokenizeField error:", err)
+	}
+	if detok != "user@example.com" {
+		t.Errorf("expected normalized original, got %q", detok)
+	}
+
+	if _, err := registry.TokenizeField("ssn", "not-an-ssn"); err == nil {
+		t.Error("expected validation error for malformed ssn")
+	}
+
+	if _, err := registry.DetokenizeField("ssn", token); err != ErrFieldTypeMismatch {
+		t.Error("expected ErrFieldTypeMismatch, got", err)
+	}
+
+	if _, err := registry.TokenizeField("pan", "4111111111111111"); err != ErrUnknownFieldType {
+		t.Error("expected ErrUnknownFieldType, got", err)
+	}
+}
+
+// Tests that TokenizeField doesn't break format preservation for an
+// FPE-backed FieldType -- the token must stay 16 digits, not be prefixed
+// with the field type name.
+func TestFieldRegistryFPEPreservesFormat(t *testing.T) {
+	fpe, err := NewFPETokenizer([]byte("0123456789abcdef"), "0123456789")
+	if err != nil {
+		t.Fatal("NewFPETokenizer error:", err)
+	}
+	registry := NewFieldRegistry()
+	registry.Register(FieldType{
+		Name:      "pan",
+		Validate:  RegexValidator(`^\d{16}$`),
+		Tokenizer: fpe,
+	})
+
+	const pan = "4111111111111111"
+	token, err := registry.TokenizeField("pan", pan)
+	if err != nil {
+		t.Fatal("TokenizeField error:", err)
+	}
+	if len(token) != len(pan) {
+		t.Errorf("token %q does not preserve the 16-digit shape of %q", token, pan)
+	}
+
+	detok, err := registry.DetokenizeField("pan", token)
+	if err != nil {
+		t.Fatal("DetokenizeField error:", err)
+	}
+	if detok != pan {
+		t.Errorf("DetokenizeField failed: %q != %q", detok, pan)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// feistelRounds is the number of Feistel rounds FF1 specifies.
+const feistelRounds = 10
+
+// fpeTokenizer implements format-preserving tokenization per NIST SP
+// 800-38G's FF1 mode.  Tokens are the same length and shape as their
+// input -- a 16-digit PAN tokenizes to 16 digits, an SSN keeps its
+// NNN-NN-NNNN form, an email keeps its local@domain form -- because any
+// run of characters outside alphabet (a "-" or "@") is left untouched and
+// only runs drawn from alphabet are transformed.  Unlike a Store-backed
+// Tokenizer, Detokenize requires no database lookup: it runs FF1 in
+// reverse using the same key.
+type fpeTokenizer struct {
+	key      []byte
+	alphabet string
+}
+
+// NewFPETokenizer returns a Tokenizer that produces deterministic,
+// reversible tokens shaped like their input, using FF1 under key over the
+// given alphabet (e.g. "0123456789" for digit-only fields).  key is an AES
+// key, so it must be 16, 24 or 32 bytes long; alphabet must have at least
+// two characters.
+func NewFPETokenizer(key []byte, alphabet string) (Tokenizer, error) {
+	if len(alphabet) < 2 {
+		return nil, errors.New("tokenizer: alphabet must have at least two characters")
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	return fpeTokenizer{key: key, alphabet: alphabet}, nil
+}
+
+func (t fpeTokenizer) radix() int {
+	return len(t.alphabet)
+}
+
+// segment is a run of input characters: either literal (outside alphabet,
+// passed through unchanged) or transformable (encoded/decoded via FF1).
+type segment struct {
+	text        string
+	transformed bool
+}
+
+// segments splits s into literal and transformable runs.  A transformable
+// run shorter than two characters can't be split into the two nonempty
+// Feistel halves FF1 requires, so it's treated as literal too.
+func (t fpeTokenizer) segments(s string) []segment {
+	var segs []segment
+	var cur []rune
+	flush := func() {
+		if len(cur) >= 2 {
+			segs = append(segs, segment{string(cur), true})
+		} else if len(cur) == 1 {
+			segs = append(segs, segment{string(cur), false})
+		}
+		cur = nil
+	}
+	for _, r := range s {
+		if strings.ContainsRune(t.alphabet, r) {
+			cur = append(cur, r)
+			continue
+		}
+		flush()
+		segs = append(segs, segment{string(r), false})
+	}
+	flush()
+	return segs
+}
+
+func (t fpeTokenizer) Tokenize(s string) (string, error) {
+	return t.transform(s, false)
+}
+
+func (t fpeTokenizer) Detokenize(s string) (string, error) {
+	return t.transform(s, true)
+}
+
+func (t fpeTokenizer) transform(s string, decrypt bool) (string, error) {
+	var out strings.Builder
+	for _, seg := range t.segments(s) {
+		if !seg.transformed {
+			out.WriteString(seg.text)
+			continue
+		}
+		numerals := t.encode(seg.text)
+		result, err := t.ff1(numerals, decrypt)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(t.decode(result))
+	}
+	return out.String(), nil
+}
+
+func (t fpeTokenizer) encode(s string) []int {
+	numerals := make([]int, len(s))
+	for i, r := range []rune(s) {
+		numerals[i] = strings.IndexRune(t.alphabet, r)
+	}
+	return numerals
+}
+
+func (t fpeTokenizer) decode(numerals []int) string {
+	chars := make([]rune, len(numerals))
+	for i, n := range numerals {
+		chars[i] = rune(t.alphabet[n])
+	}
+	return string(chars)
+}
+
+// ff1 runs the FF1 Feistel network over numerals, in the forward
+// (tokenize) direction if decrypt is false, or in reverse if true.
+func (t fpeTokenizer) ff1(numerals []int, decrypt bool) ([]int, error) {
+	block, err := aes.NewCipher(t.key)
+	if err != nil {
+		return nil, err
+	}
+	n := len(numerals)
+	u := n / 2
+	v := n - u
+	radix := t.radix()
+	p := t.pBlock(u, n)
+
+	// b and d are fixed for the whole Feistel network -- derived from v
+	// (the longer half) once, per NIST SP 800-38G -- not recomputed per
+	// round from whichever half happens to be in B that round.
+	b := fpeByteLen(radix, v)
+	d := 4*((b+3)/4) + 4
+
+	// Lengths of A and B before each round are fixed by n, u and v alone
+	// -- never by the data -- so precompute them once and walk the same
+	// table forwards to tokenize or backwards to detokenize.
+	lenA := make([]int, feistelRounds+1)
+	lenB := make([]int, feistelRounds+1)
+	lenA[0], lenB[0] = u, v
+	for i := 0; i < feistelRounds; i++ {
+		m := u
+		if i%2 != 0 {
+			m = v
+		}
+		lenA[i+1] = lenB[i]
+		lenB[i+1] = m
+	}
+
+	A := append([]int{}, numerals[:u]...)
+	B := append([]int{}, numerals[u:]...)
+
+	round := func(i int, A, B []int) ([]int, error) {
+		m := u
+		if i%2 != 0 {
+			m = v
+		}
+		q := t.qBlock(B, radix, i, b)
+		r, err := t.prf(append(append([]byte{}, p...), q...), block)
+		if err != nil {
+			return nil, err
+		}
+		y := new(big.Int).SetBytes(t.generateS(block, r, d))
+		modulus := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
+		c := new(big.Int).Add(numeralsToInt(A, radix), y)
+		c.Mod(c, modulus)
+		return intToNumerals(c, radix, m), nil
+	}
+
+	if !decrypt {
+		for i := 0; i < feistelRounds; i++ {
+			C, err := round(i, A, B)
+			if err != nil {
+				return nil, err
+			}
+			A, B = B, C
+		}
+		return append(A, B...), nil
+	}
+
+	for i := feistelRounds - 1; i >= 0; i-- {
+		// A currently holds round i's B input; recompute y the same way
+		// and invert c = (NUM(prevA)+y) mod radix^m to recover prevA.
+		m := lenB[i+1]
+		q := t.qBlock(A, radix, i, b)
+		r, err := t.prf(append(append([]byte{}, p...), q...), block)
+		if err != nil {
+			return nil, err
+		}
+		y := new(big.Int).SetBytes(t.generateS(block, r, d))
+		modulus := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
+		prevANum := new(big.Int).Sub(numeralsToInt(B, radix), y)
+		prevANum.Mod(prevANum, modulus)
+		prevA := intToNumerals(prevANum, radix, lenA[i])
+		prevB := A
+		A, B = prevA, prevB
+	}
+	return append(A, B...), nil
+}
+
+// pBlock builds FF1's fixed 16-byte P block: 1‖2‖1‖radix‖rounds‖u‖n‖tweakLen.
+// This tokenizer never uses a caller-supplied tweak, so tweakLen is 0.
+func (t fpeTokenizer) pBlock(u, n int) []byte {
+	p := make([]byte, 0, aes.BlockSize)
+	p = append(p, 1, 2, 1)
+	radix := t.radix()
+	p = append(p, byte(radix>>16), byte(radix>>8), byte(radix))
+	p = append(p, byte(feistelRounds), byte(u))
+	nb := make([]byte, 4)
+	binary.BigEndian.PutUint32(nb, uint32(n))
+	p = append(p, nb...)
+	p = append(p, 0, 0, 0, 0) // tweakLen, always 0: no tweak
+	return p
+}
+
+// qBlock builds FF1's per-round Q block: zero padding, the round number,
+// and B encoded as a big-endian numeral string, padded so that P‖Q is a
+// whole number of AES blocks.  b is the fixed byte length derived from v
+// (see ff1), not len(B), which alternates between u and v each round.
+func (t fpeTokenizer) qBlock(B []int, radix, round, b int) []byte {
+	bBytes := numeralsToInt(B, radix).Bytes()
+	padded := make([]byte, b)
+	copy(padded[b-len(bBytes):], bBytes)
+	tail := append([]byte{byte(round)}, padded...)
+	zeroPad := (aes.BlockSize - len(tail)%aes.BlockSize) % aes.BlockSize
+	q := make([]byte, zeroPad)
+	return append(q, tail...)
+}
+
+// prf is FF1's CBC-MAC pseudorandom function: encrypt data (a whole number
+// of AES blocks) under CBC with a zero IV and keep only the last block.
+func (t fpeTokenizer) prf(data []byte, block cipher.Block) ([]byte, error) {
+	iv := make([]byte, aes.BlockSize)
+	mode := cipher.NewCBCEncrypter(block, iv)
+	out := make([]byte, len(data))
+	mode.CryptBlocks(out, data)
+	return out[len(out)-aes.BlockSize:], nil
+}
+
+// generateS stretches r to at least numBytes by encrypting r XORed with
+// successive big-endian counters, per FF1's S generation step.
+func (t fpeTokenizer) generateS(block cipher.Block, r []byte, numBytes int) []byte {
+	s := append([]byte{}, r...)
+	for j := 1; len(s) < numBytes; j++ {
+		in := make([]byte, aes.BlockSize)
+		copy(in, r)
+		ctr := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(ctr[aes.BlockSize-8:], uint64(j))
+		for i := range in {
+			in[i] ^= ctr[i]
+		}
+		out := make([]byte, aes.BlockSize)
+		block.Encrypt(out, in)
+		s = append(s, out...)
+	}
+	return s[:numBytes]
+}
+
+// fpeByteLen is the number of bytes needed to hold length digits in radix.
+func fpeByteLen(radix, length int) int {
+	bits := float64(length) * math.Log2(float64(radix))
+	return int(math.Ceil(bits / 8))
+}
+
+func numeralsToInt(x []int, radix int) *big.Int {
+	n := big.NewInt(0)
+	r := big.NewInt(int64(radix))
+	for _, d := range x {
+		n.Mul(n, r)
+		n.Add(n, big.NewInt(int64(d)))
+	}
+	return n
+}
+
+func intToNumerals(n *big.Int, radix, length int) []int {
+	out := make([]int, length)
+	r := big.NewInt(int64(radix))
+	v := new(big.Int).Set(n)
+	mod := new(big.Int)
+	for i := length - 1; i >= 0; i-- {
+		v.DivMod(v, r, mod)
+		out[i] = int(mod.Int64())
+	}
+	return out
+}
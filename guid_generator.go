@@ -0,0 +1,99 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jmcvetta/guid"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// GUIDGenerator produces the unique ID a Tokenizer turns into a token.
+// The default, packageGUIDGenerator, calls the top-level guid.NextId()
+// used historically; NewGUIDGenerator gives each Tokenizer its own
+// collision-free generator instead, so N uncoordinated processes can mint
+// tokens without ever stepping on each other's IDs.
+type GUIDGenerator interface {
+	NextId() (string, error)
+}
+
+// packageGUIDGenerator is the original behavior: every call goes through
+// the single top-level guid.NextId(), shared by every Tokenizer in the
+// process.
+type packageGUIDGenerator struct{}
+
+func (packageGUIDGenerator) NextId() (string, error) {
+	g, err := guid.NextId()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v", g), nil
+}
+
+const (
+	machineIDBits = 10
+	sequenceBits  = 12
+	maxMachineID  = 1<<machineIDBits - 1
+	maxSequence   = 1<<sequenceBits - 1
+)
+
+// snowflakeGenerator is a Twitter Snowflake-style GUIDGenerator: a 41-bit
+// millisecond timestamp (relative to epoch), a 10-bit machine ID built
+// from datacenter and worker ID, and a 12-bit per-millisecond sequence.
+// Two generators with distinct (datacenterID, workerID) pairs never
+// collide; a single generator never collides with itself because it
+// stalls rather than reuse a sequence number within the same millisecond.
+type snowflakeGenerator struct {
+	epoch     time.Time
+	machineID int64
+
+	mu       sync.Mutex
+	lastTime int64
+	sequence int64
+}
+
+// NewGUIDGenerator returns a GUIDGenerator that mints Snowflake-style IDs.
+// datacenterID and workerID must each fit in 5 bits (0-31); epoch is the
+// zero point IDs are timestamped relative to, and should not change once
+// generators have started minting IDs against it.
+func NewGUIDGenerator(datacenterID, workerID int64, epoch time.Time) (GUIDGenerator, error) {
+	if datacenterID < 0 || datacenterID > 31 {
+		return nil, errors.New("tokenizer: datacenterID must be between 0 and 31")
+	}
+	if workerID < 0 || workerID > 31 {
+		return nil, errors.New("tokenizer: workerID must be between 0 and 31")
+	}
+	return &snowflakeGenerator{
+		epoch:     epoch,
+		machineID: datacenterID<<5 | workerID,
+		lastTime:  -1,
+	}, nil
+}
+
+func (g *snowflakeGenerator) NextId() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Since(g.epoch).Nanoseconds() / int64(time.Millisecond)
+	if now < g.lastTime {
+		return "", errors.New("tokenizer: clock moved backwards")
+	}
+	if now == g.lastTime {
+		g.sequence = (g.sequence + 1) & maxSequence
+		if g.sequence == 0 {
+			// Sequence exhausted for this millisecond; spin until the
+			// clock ticks forward instead of risking a collision.
+			for now <= g.lastTime {
+				now = time.Since(g.epoch).Nanoseconds() / int64(time.Millisecond)
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastTime = now
+	id := now<<(machineIDBits+sequenceBits) | g.machineID<<sequenceBits | g.sequence
+	return strconv.FormatInt(id, 10), nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+)
+
+// hashTokenizer is a Tokenizer whose tokens are a keyed HMAC-SHA256 of the
+// original value, rather than a random GUID.  Retokenizing the same
+// original is inherently idempotent -- no Store round trip is needed to
+// decide whether a new token would collide -- but a Store is still
+// required to reverse the one-way hash back to its original.
+type hashTokenizer struct {
+	key   []byte
+	store Store
+}
+
+func (t hashTokenizer) Tokenize(s string) (string, error) {
+	return t.tokenize(s, "")
+}
+
+// TokenizeField is Tokenize, but stamps the issued Record with fieldType
+// so FieldTypeOf can later report it to FieldRegistry.DetokenizeField.
+func (t hashTokenizer) TokenizeField(fieldType, s string) (string, error) {
+	return t.tokenize(s, fieldType)
+}
+
+func (t hashTokenizer) tokenize(s, fieldType string) (string, error) {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(s))
+	token := base64.URLEncoding.EncodeToString(mac.Sum(nil))
+	err := t.store.Insert(Record{Original: s, Token: token, CreatedAt: time.Now(), FieldType: fieldType})
+	if err != nil {
+		if !t.store.IsDuplicate(err) {
+			return "", err
+		}
+		// The token already exists -- since it's derived solely from s
+		// and key, that's normally just s having been tokenized before.
+		// But if the existing record was revoked, there's no new token
+		// to issue: handing the caller this one back would silently
+		// resurrect a token Detokenize will keep rejecting forever.
+		existing, lookupErr := t.store.LookupByToken(token)
+		if lookupErr == nil && existing.Revoked {
+			return "", ErrHashTokenRevoked
+		}
+	}
+	return token, nil
+}
+
+// FieldTypeOf returns the FieldType name token's Record was stamped with,
+// or "" if it wasn't issued via TokenizeField.
+func (t hashTokenizer) FieldTypeOf(token string) (string, error) {
+	rec, err := t.store.LookupByToken(token)
+	if err != nil {
+		return "", err
+	}
+	return rec.FieldType, nil
+}
+
+func (t hashTokenizer) Detokenize(s string) (string, error) {
+	rec, err := t.store.LookupByToken(s)
+	if err != nil {
+		return "", err
+	}
+	if rec.Revoked {
+		return "", ErrTokenRevoked
+	}
+	return rec.Original, nil
+}
+
+// NewHashTokenizer returns a Tokenizer that derives tokens deterministically
+// from a keyed HMAC-SHA256 of the original value, and stores the reverse
+// mapping in store.
+func NewHashTokenizer(key []byte, store Store) Tokenizer {
+	return hashTokenizer{key: key, store: store}
+}
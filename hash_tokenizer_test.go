@@ -0,0 +1,50 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests deterministic hash-based tokenization, including that a revoked
+// hash token isn't silently reissued -- since it's derived solely from
+// the original and key, retokenizing would otherwise hand back the very
+// token Detokenize keeps rejecting.
+func TestHashTokenizer(t *testing.T) {
+	store := NewMemoryStore()
+	key := []byte("0123456789abcdef")
+	tokenizer := NewHashTokenizer(key, store)
+
+	const original = "4111111111111111"
+	token, err := tokenizer.Tokenize(original)
+	if err != nil {
+		t.Fatal("Tokenize error:", err)
+	}
+	token2, err := tokenizer.Tokenize(original)
+	if err != nil {
+		t.Fatal("Tokenize error:", err)
+	}
+	if token2 != token {
+		t.Errorf("hash tokenization is not deterministic: %q != %q", token2, token)
+	}
+
+	detok, err := tokenizer.Detokenize(token)
+	if err != nil {
+		t.Fatal("Detokenize error:", err)
+	}
+	if detok != original {
+		t.Errorf("Detokenize failed: %q != %q", detok, original)
+	}
+
+	if err := store.Revoke(token, time.Now()); err != nil {
+		t.Fatal("Revoke error:", err)
+	}
+	if _, err := tokenizer.Detokenize(token); err != ErrTokenRevoked {
+		t.Error("expected ErrTokenRevoked, got", err)
+	}
+	if _, err := tokenizer.Tokenize(original); err != ErrHashTokenRevoked {
+		t.Error("expected ErrHashTokenRevoked, got", err)
+	}
+}
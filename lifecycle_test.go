@@ -0,0 +1,108 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests token expiration, revocation and rotation
+func TestLifecycle(t *testing.T) {
+	tokenizer := NewMemoryTokenizer()
+
+	expiring, err := tokenizer.TokenizeWithTTL("orig-expiring", time.Millisecond)
+	if err != nil {
+		t.Fatal("TokenizeWithTTL error:", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := tokenizer.Detokenize(expiring); err != ErrTokenExpired {
+		t.Error("expected ErrTokenExpired, got", err)
+	}
+
+	revoked, err := tokenizer.Tokenize("orig-revoked")
+	if err != nil {
+		t.Fatal("Tokenize error:", err)
+	}
+	if err := tokenizer.Revoke(revoked); err != nil {
+		t.Fatal("Revoke error:", err)
+	}
+	if _, err := tokenizer.Detokenize(revoked); err != ErrTokenRevoked {
+		t.Error("expected ErrTokenRevoked, got", err)
+	}
+
+	original := "orig-rotated"
+	oldToken, err := tokenizer.Tokenize(original)
+	if err != nil {
+		t.Fatal("Tokenize error:", err)
+	}
+	newToken, err := tokenizer.Rotate(oldToken)
+	if err != nil {
+		t.Fatal("Rotate error:", err)
+	}
+	if _, err := tokenizer.Detokenize(oldToken); err != ErrTokenRevoked {
+		t.Error("expected old token to be revoked, got", err)
+	}
+	detok, err := tokenizer.Detokenize(newToken)
+	if err != nil {
+		t.Fatal("Detokenize error:", err)
+	}
+	if detok != original {
+		t.Errorf("Rotate changed the original: %q != %q", detok, original)
+	}
+	repeat, err := tokenizer.Tokenize(original)
+	if err != nil {
+		t.Fatal("Tokenize error:", err)
+	}
+	if repeat != newToken {
+		t.Error("Tokenize after Rotate did not return the new token:", repeat, newToken)
+	}
+}
+
+// Tests that Revoke and Rotate stamp RevokedAt distinctly from CreatedAt,
+// since the sweeper's grace period is measured from the former.
+func TestLifecycleRevokedAt(t *testing.T) {
+	store := NewMemoryStore()
+	tokenizer := NewTokenizer(store)
+
+	token, err := tokenizer.Tokenize("orig-revoked-at")
+	if err != nil {
+		t.Fatal("Tokenize error:", err)
+	}
+	created, err := store.LookupByToken(token)
+	if err != nil {
+		t.Fatal("LookupByToken error:", err)
+	}
+	if !created.RevokedAt.IsZero() {
+		t.Errorf("expected zero RevokedAt before revocation, got %v", created.RevokedAt)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if err := tokenizer.Revoke(token); err != nil {
+		t.Fatal("Revoke error:", err)
+	}
+	revoked, err := store.LookupByToken(token)
+	if err != nil {
+		t.Fatal("LookupByToken error:", err)
+	}
+	if !revoked.RevokedAt.After(revoked.CreatedAt) {
+		t.Errorf("expected RevokedAt (%v) after CreatedAt (%v)", revoked.RevokedAt, revoked.CreatedAt)
+	}
+
+	oldToken, err := tokenizer.Tokenize("orig-rotated-at")
+	if err != nil {
+		t.Fatal("Tokenize error:", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := tokenizer.Rotate(oldToken); err != nil {
+		t.Fatal("Rotate error:", err)
+	}
+	old, err := store.LookupByToken(oldToken)
+	if err != nil {
+		t.Fatal("LookupByToken error:", err)
+	}
+	if !old.RevokedAt.After(old.CreatedAt) {
+		t.Errorf("expected the rotated-out token's RevokedAt (%v) after its CreatedAt (%v)", old.RevokedAt, old.CreatedAt)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Tests BearerAuth's accept and reject paths
+func TestBearerAuth(t *testing.T) {
+	var called bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := BearerAuth("secret", next)
+
+	called = false
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if !called {
+		t.Error("expected next to be called for a valid bearer token")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+
+	cases := []struct {
+		name string
+		auth string
+	}{
+		{"missing header", ""},
+		{"wrong token", "Bearer wrong"},
+		{"missing Bearer prefix", "secret"},
+		{"basic auth scheme", "Basic c2VjcmV0"},
+	}
+	for _, c := range cases {
+		called = false
+		req := httptest.NewRequest("GET", "/", nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if called {
+			t.Errorf("%s: expected next not to be called", c.name)
+		}
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status 401, got %d", c.name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package server
+
+import (
+	"github.com/jmcvetta/guid"
+	"log"
+	"net/http"
+	"time"
+)
+
+// statusWriter captures the status code a handler wrote, since
+// http.ResponseWriter doesn't expose it after the fact.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// RequestLog wraps next, logging one structured line per request: a GUID
+// identifying the request, the method, path, remote address, status code
+// and duration.  The GUID is not passed to the Tokenizer, so its own log
+// lines do not carry it.
+func RequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id interface{} = "unknown"
+		if g, err := guid.NextId(); err != nil {
+			// A correlation ID is a convenience, not a request
+			// dependency -- log the failure and fall back to a
+			// placeholder rather than taking down the server over it.
+			log.Println("RequestLog: guid.NextId failed:", err)
+		} else {
+			id = g
+		}
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		log.Printf("request_id=%v method=%s path=%s remote=%s status=%d duration=%s",
+			id, r.Method, r.URL.Path, r.RemoteAddr, sw.status, time.Since(start))
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+// Package server exposes a tokenizer.Tokenizer over HTTP and WebSocket, so
+// tokenization can be run as a standalone microservice instead of an
+// in-process dependency.
+package server
+
+import (
+	"encoding/json"
+	"github.com/jmcvetta/tokenizer"
+	"net/http"
+
+	"code.google.com/p/go.net/websocket"
+)
+
+// Request is one unit of batch work: a caller-supplied req_id for
+// correlating the response, and a set of named fields to tokenize or
+// detokenize together.
+type Request struct {
+	ReqID string            `json:"req_id"`
+	Data  map[string]string `json:"data"`
+}
+
+// Response mirrors Request, with Data's values replaced by tokens (or
+// originals, for a detokenize request).  Error is set, and Data omitted,
+// if the request as a whole failed.
+type Response struct {
+	ReqID string            `json:"req_id"`
+	Data  map[string]string `json:"data,omitempty"`
+	Error string            `json:"error,omitempty"`
+}
+
+// op is either tokenizer.Tokenizer.Tokenize or tokenizer.Tokenizer.Detokenize.
+type op func(tokenizer.Tokenizer, string) (string, error)
+
+func tokenizeOp(t tokenizer.Tokenizer, s string) (string, error)   { return t.Tokenize(s) }
+func detokenizeOp(t tokenizer.Tokenizer, s string) (string, error) { return t.Detokenize(s) }
+
+// Server handles batch tokenize/detokenize requests against a single
+// Tokenizer.
+type Server struct {
+	Tokenizer tokenizer.Tokenizer
+}
+
+// New returns a Server backed by t.
+func New(t tokenizer.Tokenizer) *Server {
+	return &Server{Tokenizer: t}
+}
+
+// Handler returns an http.Handler exposing the batch tokenize/detokenize
+// endpoints and matching WebSocket endpoints (/ws/tokenize and
+// /ws/detokenize), which take one Request per message and reply with one
+// Response.  Wrap it with BearerAuth and RequestLog as needed.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tokenize", s.handleBatch(tokenizeOp))
+	mux.HandleFunc("/detokenize", s.handleBatch(detokenizeOp))
+	mux.Handle("/ws/tokenize", websocket.Handler(s.handleWS(tokenizeOp)))
+	mux.Handle("/ws/detokenize", websocket.Handler(s.handleWS(detokenizeOp)))
+	return mux
+}
+
+func (s *Server) handleBatch(fn op) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reqs []Request
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resps := make([]Response, len(reqs))
+		for i, req := range reqs {
+			resps[i] = s.apply(fn, req)
+		}
+		json.NewEncoder(w).Encode(resps)
+	}
+}
+
+func (s *Server) handleWS(fn op) func(*websocket.Conn) {
+	return func(ws *websocket.Conn) {
+		for {
+			var req Request
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				return
+			}
+			if err := websocket.JSON.Send(ws, s.apply(fn, req)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) apply(fn op, req Request) Response {
+	resp := Response{ReqID: req.ReqID, Data: make(map[string]string, len(req.Data))}
+	for field, value := range req.Data {
+		result, err := fn(s.Tokenizer, value)
+		if err != nil {
+			return Response{ReqID: req.ReqID, Error: err.Error()}
+		}
+		resp.Data[field] = result
+	}
+	return resp
+}
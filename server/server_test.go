@@ -0,0 +1,73 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jmcvetta/tokenizer"
+)
+
+// Tests Server.apply's happy path: a tokenize then detokenize round trip
+func TestServerApply(t *testing.T) {
+	s := New(tokenizer.NewMemoryTokenizer())
+
+	req := Request{ReqID: "req-1", Data: map[string]string{"field1": "hello", "field2": "world"}}
+	resp := s.apply(tokenizeOp, req)
+	if resp.Error != "" {
+		t.Fatal("apply error:", resp.Error)
+	}
+	if resp.ReqID != req.ReqID {
+		t.Errorf("expected ReqID %q, got %q", req.ReqID, resp.ReqID)
+	}
+	if len(resp.Data) != len(req.Data) {
+		t.Errorf("expected %d tokens, got %d", len(req.Data), len(resp.Data))
+	}
+
+	detok := s.apply(detokenizeOp, Request{ReqID: "req-2", Data: resp.Data})
+	if detok.Error != "" {
+		t.Fatal("apply error:", detok.Error)
+	}
+	if detok.Data["field1"] != "hello" || detok.Data["field2"] != "world" {
+		t.Errorf("round trip failed: %#v", detok.Data)
+	}
+}
+
+// erroringTokenizer fails Tokenize for any value equal to failOn, so
+// Server.apply's partial-batch-failure path can be exercised
+// deterministically.
+type erroringTokenizer struct {
+	failOn string
+}
+
+func (e erroringTokenizer) Tokenize(s string) (string, error) {
+	if s == e.failOn {
+		return "", errors.New("tokenize failed")
+	}
+	return "tok-" + s, nil
+}
+
+func (e erroringTokenizer) Detokenize(s string) (string, error) {
+	return s, nil
+}
+
+// Tests that a single failing field fails the whole batch item, reporting
+// Error and omitting Data, rather than returning a partially tokenized
+// result.
+func TestServerApplyPartialFailure(t *testing.T) {
+	s := New(erroringTokenizer{failOn: "bad"})
+
+	req := Request{ReqID: "req-1", Data: map[string]string{"field1": "bad"}}
+	resp := s.apply(tokenizeOp, req)
+	if resp.Error == "" {
+		t.Fatal("expected apply to report an error")
+	}
+	if resp.Data != nil {
+		t.Errorf("expected no Data on a failed batch item, got %#v", resp.Data)
+	}
+	if resp.ReqID != req.ReqID {
+		t.Errorf("expected ReqID %q, got %q", req.ReqID, resp.ReqID)
+	}
+}
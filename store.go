@@ -0,0 +1,50 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import "time"
+
+// Record is everything a Store keeps about one token: the original value
+// it represents, its lifecycle timestamps, whether it has been revoked,
+// and the FieldType name it was issued under, if any.
+type Record struct {
+	Original  string
+	Token     string
+	CreatedAt time.Time
+	ExpiresAt time.Time // zero value means the token never expires
+	Revoked   bool
+	RevokedAt time.Time // zero value means Revoked is false
+	FieldType string    // empty unless issued via FieldRegistry.TokenizeField
+}
+
+// Store is the persistence interface a Tokenizer delegates to.  Any backend
+// able to satisfy Store -- MongoDB, Redis, an in-memory map, etc -- can be
+// plugged into NewTokenizer.
+type Store interface {
+	// LookupByOriginal returns the active (non-revoked) record for
+	// original, or TokenNotFound if original has no active token.
+	LookupByOriginal(original string) (Record, error)
+	// LookupByToken returns the record for token, whatever its lifecycle
+	// state, or TokenNotFound if token is unknown.  Tokenizer.Detokenize
+	// is responsible for turning an expired or revoked record into
+	// ErrTokenExpired or ErrTokenRevoked.
+	LookupByToken(token string) (Record, error)
+	// Insert atomically records a new, active token.  It must fail if
+	// original already has an active token or token already exists, so
+	// Tokenize can detect a collision and retry; use IsDuplicate to
+	// recognize that failure.
+	Insert(rec Record) error
+	// Revoke marks token's record revoked, stamped with now, retaining it
+	// for audit rather than deleting it.  It returns TokenNotFound if
+	// token is unknown.
+	Revoke(token string, now time.Time) error
+	// Rotate atomically revokes oldToken, stamped with now, and records
+	// newToken as the active token for oldToken's original, also stamped
+	// with now.  It returns TokenNotFound if oldToken is unknown.
+	Rotate(oldToken, newToken string, now time.Time) error
+	// IsDuplicate reports whether err is the failure Insert returns when
+	// original or token already exist, as opposed to some other backend
+	// failure that the caller can't sensibly retry.
+	IsDuplicate(err error) bool
+}
@@ -0,0 +1,127 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errMemoryDuplicate is returned by memoryStore.Insert when the original or
+// token already exists.
+var errMemoryDuplicate = errors.New("tokenizer: key already exists in memory store")
+
+// memoryStore is an in-memory Store.  It is intended for tests and
+// benchmarks that need a working Tokenizer without a running database.
+type memoryStore struct {
+	mu               sync.Mutex
+	byToken          map[string]Record
+	activeByOriginal map[string]string // original -> currently active token
+}
+
+func (s *memoryStore) LookupByOriginal(original string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.activeByOriginal[original]
+	if !ok {
+		return Record{}, TokenNotFound
+	}
+	rec := s.byToken[token]
+	if rec.Revoked || s.isExpired(rec) {
+		// Stale pointer left by Revoke or by the record aging out; clear
+		// it so original is free to be tokenized again.
+		delete(s.activeByOriginal, original)
+		return Record{}, TokenNotFound
+	}
+	return rec, nil
+}
+
+func (s *memoryStore) isExpired(rec Record) bool {
+	return !rec.ExpiresAt.IsZero() && time.Now().After(rec.ExpiresAt)
+}
+
+func (s *memoryStore) LookupByToken(token string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.byToken[token]
+	if !ok {
+		return Record{}, TokenNotFound
+	}
+	return rec, nil
+}
+
+func (s *memoryStore) Insert(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.activeByOriginal[rec.Original]; ok {
+		return errMemoryDuplicate
+	}
+	if _, ok := s.byToken[rec.Token]; ok {
+		return errMemoryDuplicate
+	}
+	s.byToken[rec.Token] = rec
+	s.activeByOriginal[rec.Original] = rec.Token
+	return nil
+}
+
+func (s *memoryStore) Revoke(token string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.byToken[token]
+	if !ok {
+		return TokenNotFound
+	}
+	rec.Revoked = true
+	rec.RevokedAt = now
+	s.byToken[token] = rec
+	// Free original for re-tokenization, unless it's already pointing
+	// somewhere else (e.g. a Rotate landed between our lookup and here).
+	if s.activeByOriginal[rec.Original] == token {
+		delete(s.activeByOriginal, rec.Original)
+	}
+	return nil
+}
+
+func (s *memoryStore) Rotate(oldToken, newToken string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.byToken[oldToken]
+	if !ok {
+		return TokenNotFound
+	}
+	if old.Revoked {
+		return ErrTokenRevoked
+	}
+	old.Revoked = true
+	old.RevokedAt = now
+	s.byToken[oldToken] = old
+	s.byToken[newToken] = Record{
+		Original:  old.Original,
+		Token:     newToken,
+		CreatedAt: now,
+		ExpiresAt: old.ExpiresAt,
+	}
+	s.activeByOriginal[old.Original] = newToken
+	return nil
+}
+
+func (s *memoryStore) IsDuplicate(err error) bool {
+	return err == errMemoryDuplicate
+}
+
+// NewMemoryStore returns a Store that keeps all tokens in memory.  It is
+// intended for tests and benchmarks, not production use.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		byToken:          make(map[string]Record),
+		activeByOriginal: make(map[string]string),
+	}
+}
+
+// NewMemoryTokenizer returns a LifecycleTokenizer backed by an in-memory
+// Store.
+func NewMemoryTokenizer() LifecycleTokenizer {
+	return NewTokenizer(NewMemoryStore())
+}
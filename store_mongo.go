@@ -0,0 +1,195 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"launchpad.net/mgo"
+	"launchpad.net/mgo/bson"
+	"time"
+)
+
+// mongoStore is a Store backed by the "tokens" collection of a MongoDB
+// database.
+type mongoStore struct {
+	db *mgo.Database
+}
+
+// Get the MongoDB collection object containing our tokens.
+func (s mongoStore) collection() *mgo.Collection {
+	// lightweight operation, involves no network communication
+	return s.db.C("tokens")
+}
+
+// active returns the collection mapping an original to its currently
+// active token.  It exists because Mongo's unique index can't be
+// conditioned on "revoked": false, so nothing stops two Inserts racing to
+// claim the same original once "original" stops being a unique index (see
+// Rotate and NewMongoStore); a doc here, unique on "original", is the
+// atomic claim that replaces it.
+func (s mongoStore) active() *mgo.Collection {
+	// lightweight operation, involves no network communication
+	return s.db.C("active_tokens")
+}
+
+func (s mongoStore) LookupByOriginal(original string) (Record, error) {
+	pointer := bson.M{}
+	err := s.active().Find(bson.M{"original": original}).One(&pointer)
+	if err == mgo.NotFound {
+		return Record{}, TokenNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	token, _ := pointer["token"].(string)
+	result := Record{}
+	err = s.collection().Find(bson.M{"token": token}).One(&result)
+	if err != nil && err != mgo.NotFound {
+		return Record{}, err
+	}
+	if err == mgo.NotFound || result.Revoked || (!result.ExpiresAt.IsZero() && time.Now().After(result.ExpiresAt)) {
+		// Stale pointer left by Revoke or by the record aging out (or
+		// by the record having been deleted); clear it, unless
+		// something else has since claimed it, so original is free to be
+		// tokenized again.
+		s.active().Remove(bson.M{"original": original, "token": token})
+		return Record{}, TokenNotFound
+	}
+	return result, nil
+}
+
+func (s mongoStore) LookupByToken(token string) (Record, error) {
+	result := Record{}
+	err := s.collection().Find(bson.M{"token": token}).One(&result)
+	if err == mgo.NotFound {
+		return Record{}, TokenNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	return result, nil
+}
+
+// Insert claims original in the active collection before inserting rec
+// into tokens, so a racing Insert for the same original fails on the
+// active collection's unique index rather than leaving two live records
+// for one original.
+func (s mongoStore) Insert(rec Record) error {
+	if err := s.active().Insert(bson.M{"original": rec.Original, "token": rec.Token}); err != nil {
+		return err
+	}
+	if err := s.collection().Insert(&rec); err != nil {
+		// Roll back the claim so a failed or colliding tokens write
+		// doesn't permanently wedge original against retokenizing.
+		s.active().Remove(bson.M{"original": rec.Original, "token": rec.Token})
+		return err
+	}
+	return nil
+}
+
+func (s mongoStore) Revoke(token string, now time.Time) error {
+	rec := Record{}
+	err := s.collection().Find(bson.M{"token": token}).One(&rec)
+	if err == mgo.NotFound {
+		return TokenNotFound
+	}
+	if err != nil {
+		return err
+	}
+	err = s.collection().Update(bson.M{"token": token}, bson.M{"$set": bson.M{"revoked": true, "revokedat": now}})
+	if err != nil {
+		return err
+	}
+	// Free original for re-tokenization, unless it's already pointing
+	// somewhere else (e.g. a Rotate landed between our lookup and here).
+	s.active().Remove(bson.M{"original": rec.Original, "token": token})
+	return nil
+}
+
+func (s mongoStore) Rotate(oldToken, newToken string, now time.Time) error {
+	old := Record{}
+	err := s.collection().Find(bson.M{"token": oldToken}).One(&old)
+	if err == mgo.NotFound {
+		return TokenNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if old.Revoked {
+		return ErrTokenRevoked
+	}
+	rec := Record{
+		Original:  old.Original,
+		Token:     newToken,
+		CreatedAt: now,
+		ExpiresAt: old.ExpiresAt,
+	}
+	if err := s.collection().Insert(&rec); err != nil {
+		return err
+	}
+	err = s.active().Update(bson.M{"original": old.Original, "token": oldToken}, bson.M{"$set": bson.M{"token": newToken}})
+	if err != nil && err != mgo.NotFound {
+		return err
+	}
+	return s.collection().Update(bson.M{"token": oldToken}, bson.M{"$set": bson.M{"revoked": true, "revokedat": now}})
+}
+
+// IsDuplicate reports whether err is a MongoDB duplicate key error (code
+// 11000), which means the original or token were already inserted by a
+// different tokenizer process.
+func (s mongoStore) IsDuplicate(err error) bool {
+	e, ok := err.(*mgo.LastError)
+	return ok && e.Code == 11000
+}
+
+// NewMongoStore returns a Store backed by the "tokens" collection in db.
+// If the collections are not yet set up, NewMongoStore sets them up;
+// otherwise this is a noop.  The "token" index is unique since a token
+// must never be issued twice; "original" is not, since Rotate deliberately
+// leaves behind a revoked record with the same original as the newly
+// active one -- at most one of those records is ever non-revoked.  That
+// invariant is enforced not by this collection's index but by the unique
+// "original" index on the "active_tokens" collection, which Insert and
+// Rotate use to atomically claim or move an original.  The "expiresat"
+// index is built with ExpireAfter 0, which mgo sends without an
+// expireAfterSeconds option, so it is an ordinary index, not a TTL index:
+// MongoDB does not purge expired records on its own.  An expired record
+// stays in the collection, and Detokenize reports it as ErrTokenExpired.
+func NewMongoStore(db *mgo.Database) Store {
+	col := db.C("tokens")
+	col.EnsureIndex(mgo.Index{
+		Key:    []string{"original"},
+		Sparse: true,
+	})
+	col.EnsureIndex(mgo.Index{
+		Key:      []string{"token"},
+		Unique:   true,
+		DropDups: false,
+		Sparse:   true,
+	})
+	col.EnsureIndex(mgo.Index{
+		Key:         []string{"expiresat"},
+		ExpireAfter: 0,
+		Sparse:      true,
+	})
+	db.C("active_tokens").EnsureIndex(mgo.Index{
+		Key:    []string{"original"},
+		Unique: true,
+	})
+	return mongoStore{db: db}
+}
+
+// NewMongoTokenizer returns a LifecycleTokenizer backed by a MongoDB
+// database.
+func NewMongoTokenizer(db *mgo.Database) LifecycleTokenizer {
+	return NewTokenizer(NewMongoStore(db))
+}
+
+// NewMongoTokenizerWithGenerator returns a LifecycleTokenizer backed by a
+// MongoDB database, minting new tokens from gen instead of the
+// process-wide guid.NextId().  Give each uncoordinated process its own
+// gen, built with NewGUIDGenerator and a distinct datacenter/worker ID, to
+// run them collision-free against the same database.
+func NewMongoTokenizerWithGenerator(db *mgo.Database, gen GUIDGenerator) LifecycleTokenizer {
+	return NewTokenizerWithGenerator(NewMongoStore(db), gen)
+}
@@ -0,0 +1,198 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/garyburd/redigo/redis"
+	"time"
+)
+
+// errRedisDuplicate is returned by redisStore.Insert when the original or
+// token already exists.
+var errRedisDuplicate = errors.New("tokenizer: key already exists in Redis")
+
+// redisStore is a Store backed by Redis.  It uses two keyspaces: one
+// mapping original values to the currently active token, keyed
+// "orig:<original>", and one mapping tokens to their JSON-encoded Record,
+// keyed "tok:<token>".
+type redisStore struct {
+	pool *redis.Pool
+}
+
+func (s redisStore) LookupByOriginal(original string) (Record, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	token, err := redis.String(conn.Do("GET", "orig:"+original))
+	if err == redis.ErrNil {
+		return Record{}, TokenNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	rec, err := s.lookupToken(conn, token)
+	if err == TokenNotFound {
+		// The "tok:" key aged out via its native Redis expiry; clear the
+		// pointer so original is free to be tokenized again.
+		s.clearPointer(conn, original, token)
+		return Record{}, TokenNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	if rec.Revoked || (!rec.ExpiresAt.IsZero() && time.Now().After(rec.ExpiresAt)) {
+		// Stale pointer left by Revoke or by the record aging out; clear
+		// it (if nothing else has since claimed it) so original is free
+		// to be tokenized again.
+		s.clearPointer(conn, original, token)
+		return Record{}, TokenNotFound
+	}
+	return rec, nil
+}
+
+// clearPointer removes the "orig:" pointer for original, but only if it
+// still points at token -- a concurrent Rotate may already have moved it.
+func (s redisStore) clearPointer(conn redis.Conn, original, token string) {
+	current, err := redis.String(conn.Do("GET", "orig:"+original))
+	if err == nil && current == token {
+		conn.Do("DEL", "orig:"+original)
+	}
+}
+
+func (s redisStore) LookupByToken(token string) (Record, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	return s.lookupToken(conn, token)
+}
+
+func (s redisStore) lookupToken(conn redis.Conn, token string) (Record, error) {
+	data, err := redis.Bytes(conn.Do("GET", "tok:"+token))
+	if err == redis.ErrNil {
+		return Record{}, TokenNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Record{}, err
+	}
+	return rec, nil
+}
+
+// Insert uses SETNX on both keyspaces so that a racing tokenizer process
+// which already claimed original or token causes us to fail cleanly rather
+// than clobber its record.  If rec has an ExpiresAt, the "tok:" key is
+// given a matching native Redis expiry as well as the one
+// Tokenizer.Detokenize checks in Record itself.
+func (s redisStore) Insert(rec Record) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+	ok, err := redis.Bool(conn.Do("SETNX", "orig:"+rec.Original, rec.Token))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errRedisDuplicate
+	}
+	if err := s.putToken(conn, rec); err != nil {
+		// Roll back the orig: pointer so a failed or colliding tok:
+		// write doesn't permanently wedge original against retokenizing.
+		conn.Do("DEL", "orig:"+rec.Original)
+		return err
+	}
+	return nil
+}
+
+func (s redisStore) putToken(conn redis.Conn, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	ok, err := redis.Bool(conn.Do("SETNX", "tok:"+rec.Token, data))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errRedisDuplicate
+	}
+	if !rec.ExpiresAt.IsZero() {
+		ttl := rec.ExpiresAt.Sub(time.Now())
+		if ttl > 0 {
+			ms := int64((ttl + time.Millisecond - 1) / time.Millisecond)
+			conn.Do("PEXPIRE", "tok:"+rec.Token, ms)
+		}
+	}
+	return nil
+}
+
+func (s redisStore) Revoke(token string, now time.Time) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+	rec, err := s.lookupToken(conn, token)
+	if err != nil {
+		return err
+	}
+	rec.Revoked = true
+	rec.RevokedAt = now
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Do("SET", "tok:"+token, data); err != nil {
+		return err
+	}
+	// Free original for re-tokenization, unless it's already pointing
+	// somewhere else (e.g. a Rotate landed between our lookup and here).
+	s.clearPointer(conn, rec.Original, token)
+	return nil
+}
+
+func (s redisStore) Rotate(oldToken, newToken string, now time.Time) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+	old, err := s.lookupToken(conn, oldToken)
+	if err != nil {
+		return err
+	}
+	if old.Revoked {
+		return ErrTokenRevoked
+	}
+	newRec := Record{
+		Original:  old.Original,
+		Token:     newToken,
+		CreatedAt: now,
+		ExpiresAt: old.ExpiresAt,
+	}
+	if err := s.putToken(conn, newRec); err != nil {
+		return err
+	}
+	if _, err := conn.Do("SET", "orig:"+old.Original, newToken); err != nil {
+		return err
+	}
+	old.Revoked = true
+	old.RevokedAt = now
+	data, err := json.Marshal(old)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Do("SET", "tok:"+oldToken, data)
+	return err
+}
+
+func (s redisStore) IsDuplicate(err error) bool {
+	return err == errRedisDuplicate
+}
+
+// NewRedisStore returns a Store backed by Redis connections drawn from pool.
+func NewRedisStore(pool *redis.Pool) Store {
+	return redisStore{pool: pool}
+}
+
+// NewRedisTokenizer returns a LifecycleTokenizer backed by a Redis
+// database.
+func NewRedisTokenizer(pool *redis.Pool) LifecycleTokenizer {
+	return NewTokenizer(NewRedisStore(pool))
+}
@@ -0,0 +1,42 @@
+// Copyright 2012 Jason McVetta.  This is Free Software, released under
+// an MIT-style license.  See README.md for details.
+
+package tokenizer
+
+import (
+	"launchpad.net/mgo"
+	"launchpad.net/mgo/bson"
+	"log"
+	"time"
+)
+
+// StartMongoSweeper launches a background goroutine that, every interval,
+// deletes records revoked more than grace ago, measured from RevokedAt,
+// not CreatedAt.  This is opt-in.  Only revoked records are deleted:
+// expired records that were never revoked are left in place, and the
+// "expiresat" index NewMongoStore sets up is not a TTL index, so MongoDB
+// does not purge them either.  Call the returned func to stop it.
+func StartMongoSweeper(db *mgo.Database, grace, interval time.Duration) (stop func()) {
+	col := db.C("tokens")
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				cutoff := time.Now().Add(-grace)
+				_, err := col.RemoveAll(bson.M{
+					"revoked":   true,
+					"revokedat": bson.M{"$lt": cutoff},
+				})
+				if err != nil {
+					log.Println("tokenizer: sweeper:", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -7,114 +7,152 @@ package tokenizer
 import (
 	"encoding/base64"
 	"errors"
-	"fmt"
-	"github.com/jmcvetta/guid"
-	"launchpad.net/mgo"
-	"launchpad.net/mgo/bson"
 	"log"
+	"time"
 )
 
-// A TokenNotFound error is returned by GetOriginal if the supplied token 
-// string cannot be found in the database.
+// A TokenNotFound error is returned by a Store, and in turn by Detokenize,
+// if the supplied original or token string cannot be found.
 var TokenNotFound = errors.New("Token Not Found")
 
-// Tokenizer generates tokens that represent, but are not programmatically 
-// derived from, original text.
+// ErrTokenExpired is returned by Detokenize if token's TTL, set via
+// TokenizeWithTTL, has elapsed.
+var ErrTokenExpired = errors.New("Token Expired")
+
+// ErrTokenRevoked is returned by Detokenize if token was revoked, either
+// directly via Revoke or as the old half of a Rotate.
+var ErrTokenRevoked = errors.New("Token Revoked")
+
+// ErrHashTokenRevoked is returned by hashTokenizer.Tokenize if s's
+// deterministic token was already issued but has since been revoked.
+// Unlike a Rotate, there is no new token to fall back to: a hash token is
+// derived solely from s and the tokenizer's key, so reissuing it would
+// just hand back the same revoked token.
+var ErrHashTokenRevoked = errors.New("tokenizer: token for this original was revoked and cannot be reissued")
+
+// Tokenizer generates tokens that represent original text, and reverses
+// them back to it.
 type Tokenizer interface {
 	Tokenize(string) (string, error)   // Get a token
 	Detokenize(string) (string, error) // Get the original text
 }
 
-// tokenRecord represents a token in the database.
-type tokenRecord struct {
-	Text  string
-	Token string
+// LifecycleTokenizer is a Tokenizer whose tokens can age out, be revoked,
+// or be rotated to a new token without losing the mapping to their
+// original value.  NewTokenizer and the Mongo, Redis and memory
+// constructors built on it return one; the hash Tokenizer, though
+// Store-backed, is not one, and neither is the stateless FPE Tokenizer,
+// which has no record to expire or revoke.
+type LifecycleTokenizer interface {
+	Tokenizer
+	// TokenizeWithTTL is Tokenize, but the token stops working -- with
+	// Detokenize returning ErrTokenExpired -- once ttl has elapsed.
+	TokenizeWithTTL(s string, ttl time.Duration) (string, error)
+	// Revoke makes token stop working immediately; Detokenize will
+	// return ErrTokenRevoked.  The record is retained for audit.
+	Revoke(token string) error
+	// Rotate issues a new token for the same original that token
+	// represents, and revokes token.  It returns TokenNotFound if token
+	// is unknown, or ErrTokenRevoked if token was already revoked.
+	Rotate(token string) (newToken string, err error)
+}
+
+// FieldTaggedTokenizer is implemented by a Tokenizer that can stamp a
+// token's underlying Record with the FieldType name it was issued under,
+// and report that name back later.  storeTokenizer and hashTokenizer --
+// the Store-backed strategies -- implement it; the stateless FPE
+// Tokenizer does not, since it has no Record to stamp.
+// FieldRegistry.TokenizeField and DetokenizeField use this to enforce
+// that a token issued for one field type isn't reversed as another,
+// falling back to plain Tokenize/Detokenize when a Tokenizer doesn't
+// implement it.
+type FieldTaggedTokenizer interface {
+	Tokenizer
+	// TokenizeField is Tokenize, but stamps the issued Record with
+	// fieldType.
+	TokenizeField(fieldType, s string) (string, error)
+	// FieldTypeOf returns the FieldType name token's Record was stamped
+	// with, or "" if it wasn't issued via TokenizeField.
+	FieldTypeOf(token string) (string, error)
+}
+
+// storeTokenizer is a LifecycleTokenizer backed by a Store.
+type storeTokenizer struct {
+	store Store
+	gen   GUIDGenerator
+}
+
+func (t storeTokenizer) Tokenize(s string) (string, error) {
+	return t.tokenize(s, 0, "")
 }
 
-// MongoTokenizer allows you to tokenize and detokenize strings.
-type mongoTokenizer struct {
-	db *mgo.Database
+func (t storeTokenizer) TokenizeWithTTL(s string, ttl time.Duration) (string, error) {
+	return t.tokenize(s, ttl, "")
 }
 
-// Get the MongoDB collection object containing our tokens.
-func (t mongoTokenizer) collection() *mgo.Collection {
-	// lightweight operation, involves no network communication
-	col := t.db.C("tokens")
-	return col
+// TokenizeField is Tokenize, but stamps the issued Record with fieldType
+// so FieldTypeOf can later report it to FieldRegistry.DetokenizeField.
+func (t storeTokenizer) TokenizeField(fieldType, s string) (string, error) {
+	return t.tokenize(s, 0, fieldType)
 }
 
-// Fetches the token for string s from the database.
-func (t mongoTokenizer) fetchToken(s string) (string, error) {
-	log.Println("fetchToken:", s)
-	var token string
-	col := t.collection()
-	result := tokenRecord{}
-	err := col.Find(bson.M{"original": s}).One(&result)
-	if err == nil {
-		token = result.Token
+// FieldTypeOf returns the FieldType name token's Record was stamped with,
+// or "" if it wasn't issued via TokenizeField.
+func (t storeTokenizer) FieldTypeOf(token string) (string, error) {
+	rec, err := t.store.LookupByToken(token)
+	if err != nil {
+		return "", err
 	}
-	return token, err
+	return rec.FieldType, nil
 }
 
-func (t mongoTokenizer) Tokenize(s string) (string, error) {
+func (t storeTokenizer) tokenize(s string, ttl time.Duration, fieldType string) (string, error) {
 	log.Println("Tokenize:", s)
 	var result string
 	var err error
-	col := t.collection()
 	for {
-		// 
+		//
 		// First check for an existing token
 		//
-		var token string
-		token, err = t.fetchToken(s)
+		var rec Record
+		rec, err = t.store.LookupByOriginal(s)
 		if err == nil {
-			log.Println("Existing token:", token)
-			result = token
+			log.Println("Existing token:", rec.Token)
+			result = rec.Token
 			break
 		}
-		if err != mgo.NotFound {
-			// NotFound is harmless - anything else is WTF
+		if err != TokenNotFound {
+			// TokenNotFound is harmless - anything else is WTF
 			break // Will return a nil result and a non-nil error
 		}
 		log.Println("No existing token.")
 		//
 		// No existing token found, so generate a new token
 		//
-		// TODO: Instead of using top-level NextId(), each Tokenizer should 
-		// have its own guid.Generator, which can be configurable with 
-		// datacenter & worker IDs.  Once that is in place we should be 
-		// guaranteed against guid collision even when running multiple
-		// uncoordinated tokenizers.
-		//
-		guid, err := guid.NextId()
-		// We return MongoDB errors because the caller might reasonably want
-		// to deal with them.  However the caller almost certainly can't deal
-		// with an error caused by guid.NextId().
-		if err != nil {
-			log.Panic(err)
+		guidstr, genErr := t.gen.NextId()
+		if genErr != nil {
+			return "", genErr
 		}
-		guidstr := fmt.Sprintf("%v", guid)
-		token = base64.StdEncoding.EncodeToString([]byte(guidstr))
-		trec := tokenRecord{
-			Text:  s,
-			Token: token,
+		token := base64.StdEncoding.EncodeToString([]byte(guidstr))
+		now := time.Now()
+		rec = Record{Original: s, Token: token, CreatedAt: now, FieldType: fieldType}
+		if ttl > 0 {
+			rec.ExpiresAt = now.Add(ttl)
 		}
-		log.Println(trec)
-		err = col.Insert(&trec)
+		err = t.store.Insert(rec)
 		if err == nil {
 			// Success!
 			log.Println("New token:", token)
 			result = token
 			break
 		}
-		// MongoDB error code 11000 = duplicate key error Either the token or
-		// the original are already in the DB, possibly put there by a
-		// different tokenizer process.  The original may have already been 
-		// tokenized by another process, or (less likely) there may have been a 
-		// guid collision.  Either way, let's try again.
-		if e, ok := err.(*mgo.LastError); ok && e.Code == 11000 {
+		// Either the token or the original are already in the store,
+		// possibly put there by a different tokenizer process.  The
+		// original may have already been tokenized by another process, or
+		// (less likely) there may have been a guid collision.  Either way,
+		// let's try again.
+		if t.store.IsDuplicate(err) {
 			log.Println("Duplicate key")
-			log.Println(e)
 			continue
 		}
 		break // Will return a nil result and a non-nil error
@@ -122,51 +160,58 @@ func (t mongoTokenizer) Tokenize(s string) (string, error) {
 	return result, err
 }
 
-func (t mongoTokenizer) Detokenize(s string) (string, error) {
+func (t storeTokenizer) Detokenize(s string) (string, error) {
 	log.Println("Detokenize:", s)
 	log.Println("  Token:      " + s)
-	var orig string
-	var err error
-	col := t.collection()
-	result := tokenRecord{}
-	query := col.Find(bson.M{"token": s})
-	switch db_err := query.One(&result); true {
-	case db_err == mgo.NotFound:
-		log.Println("Token not found in DB")
-		err = TokenNotFound
-		return orig, err
-	case db_err != nil:
-		log.Panic(err)
+	rec, err := t.store.LookupByToken(s)
+	if err != nil {
+		return "", err
+	}
+	if rec.Revoked {
+		return "", ErrTokenRevoked
+	}
+	if !rec.ExpiresAt.IsZero() && time.Now().After(rec.ExpiresAt) {
+		return "", ErrTokenExpired
 	}
-	log.Println(result)
-	orig = result.Text
-	log.Println("Found original for token: " + orig)
-	return orig, err
+	log.Println("Found original for token: " + rec.Original)
+	return rec.Original, nil
 }
 
-// NewMongoTokenizer returns a Tokenizer backed by a MongDB database
-func NewMongoTokenizer(db *mgo.Database) Tokenizer {
-	//
-	// Setup database.  If DB is already setup, this is a noop.
-	//
-	col := db.C("tokens")
-	col.EnsureIndex(mgo.Index{
-		Key:      []string{"original"},
-		Unique:   true,
-		DropDups: false,
-		Sparse:   true,
-	})
-	col.EnsureIndex(mgo.Index{
-		Key:      []string{"token"},
-		Unique:   true,
-		DropDups: false,
-		Sparse:   true,
-	})
-	//
-	// Initialize tokenizer
-	//
-	t := mongoTokenizer{
-		db: db,
+func (t storeTokenizer) Revoke(token string) error {
+	return t.store.Revoke(token, time.Now())
+}
+
+func (t storeTokenizer) Rotate(token string) (string, error) {
+	rec, err := t.store.LookupByToken(token)
+	if err != nil {
+		return "", err
+	}
+	if rec.Revoked {
+		return "", ErrTokenRevoked
 	}
-	return t
+	guidstr, err := t.gen.NextId()
+	if err != nil {
+		return "", err
+	}
+	newToken := base64.StdEncoding.EncodeToString([]byte(guidstr))
+	if err := t.store.Rotate(token, newToken, time.Now()); err != nil {
+		return "", err
+	}
+	return newToken, nil
+}
+
+// NewTokenizer returns a LifecycleTokenizer backed by store, minting new
+// tokens from the process-wide guid.NextId().  Use
+// NewTokenizerWithGenerator to give it its own GUIDGenerator instead.
+func NewTokenizer(store Store) LifecycleTokenizer {
+	return storeTokenizer{store: store, gen: packageGUIDGenerator{}}
+}
+
+// NewTokenizerWithGenerator returns a LifecycleTokenizer backed by store,
+// minting new tokens from gen.  Distinct Tokenizers can run in
+// uncoordinated processes without ever generating the same token,
+// provided each is given a GUIDGenerator with a distinct datacenter/worker
+// ID.
+func NewTokenizerWithGenerator(store Store, gen GUIDGenerator) LifecycleTokenizer {
+	return storeTokenizer{store: store, gen: gen}
 }
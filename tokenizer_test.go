@@ -6,28 +6,17 @@ package tokenizer
 import (
 	"fmt"
 	"github.com/jmcvetta/goutil"
-	"launchpad.net/mgo"
 	"log"
 	"testing"
 )
 
-// Tests tokenization 
+// Tests tokenization
 func TestRoundTrip(t *testing.T) {
 	log.SetFlags(log.Ltime | log.Lshortfile)
 	var token string
-	log.Println("Connecting to MongoDB...")
-	session, err := mgo.Dial("localhost")
-	if err != nil {
-		t.Fatal("Could not connect to MongoDB:", err)
-	}
-	db := session.DB("test_gokenizer_tokenizer")
-	err = db.DropDatabase()
-	if err != nil {
-		t.Fatal(err)
-	}
-	tokenizer := NewMongoTokenizer(db)
+	tokenizer := NewMemoryTokenizer()
 	orig := goutil.RandAlphanumeric(8, 8)
-	token, err = tokenizer.Tokenize(orig)
+	token, err := tokenizer.Tokenize(orig)
 	if err != nil {
 		t.Error("Tokenize error:", err)
 	}
@@ -51,20 +40,11 @@ func TestRoundTrip(t *testing.T) {
 	}
 }
 
-// Tests tokenization 
+// Tests tokenization
 func BenchmarkRoundTrip(b *testing.B) {
 	b.StopTimer()
 	log.SetFlags(log.Ltime | log.Lshortfile)
-	session, err := mgo.Dial("localhost")
-	if err != nil {
-		b.Fatal("Could not connect to MongoDB:", err)
-	}
-	db := session.DB("test_gokenizer_tokenizer")
-	err = db.DropDatabase()
-	if err != nil {
-		b.Fatal("Could not drop test db:", err)
-	}
-	tokenizer := NewMongoTokenizer(db)
+	tokenizer := NewMemoryTokenizer()
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		orig := goutil.RandAlphanumeric(8, 8)